@@ -0,0 +1,36 @@
+package irc
+
+import "testing"
+
+func TestBatchReplyTagsEveryInnerLine(t *testing.T) {
+	client := NewClient(NewServer("test"))
+	client.Caps.Enable(CapBatch)
+
+	batch := NewBatchReply("names", []string{"#chan"}, []Reply{
+		newFakeLine("line one"),
+		newFakeLine("line two"),
+	})
+
+	lines := collectLines(t, client, batch)
+	if len(lines) != 4 {
+		t.Fatalf("expected BATCH start, 2 tagged lines, BATCH end, got %v", lines)
+	}
+	for _, line := range lines[1:3] {
+		if !hasTag(line, "batch") {
+			t.Errorf("inner batch line missing batch=<ref> tag: %q", line)
+		}
+	}
+}
+
+func TestBatchReplyFallsBackWithoutCapability(t *testing.T) {
+	client := NewClient(NewServer("test"))
+
+	batch := NewBatchReply("names", []string{"#chan"}, []Reply{
+		newFakeLine("line one"),
+	})
+
+	lines := collectLines(t, client, batch)
+	if len(lines) != 1 || lines[0] != "line one" {
+		t.Fatalf("clients without the batch capability should see inner replies unwrapped, got %v", lines)
+	}
+}
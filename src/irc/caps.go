@@ -0,0 +1,125 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// CapSet tracks the IRCv3 capabilities a single client has negotiated.
+type CapSet struct {
+	enabled map[string]bool
+}
+
+func NewCapSet() *CapSet {
+	return &CapSet{enabled: make(map[string]bool)}
+}
+
+func (caps *CapSet) Has(name string) bool {
+	if caps == nil {
+		return false
+	}
+	return caps.enabled[name]
+}
+
+func (caps *CapSet) Enable(name string) {
+	caps.enabled[name] = true
+}
+
+func (caps *CapSet) Disable(name string) {
+	delete(caps.enabled, name)
+}
+
+// Strings returns the enabled capability names, sorted, for use in CAP LIST
+// replies.
+func (caps *CapSet) Strings() []string {
+	names := make([]string, 0, len(caps.enabled))
+	for name := range caps.enabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capability registry
+
+type capability struct {
+	name    string
+	version int
+}
+
+var capabilityRegistry = make(map[string]capability)
+
+// RegisterCapability advertises a capability under CAP LS so that clients
+// may REQ it. Subsystems call this from an init() as they come online;
+// version is the CAP LS 302 version number the capability appeared in.
+func RegisterCapability(name string, version int) {
+	capabilityRegistry[name] = capability{name: name, version: version}
+}
+
+func init() {
+	RegisterCapability(CapMessageTags, 302)
+	RegisterCapability(CapServerTime, 302)
+	RegisterCapability(CapAccountTag, 302)
+	RegisterCapability(CapBatch, 302)
+}
+
+func registeredCapabilityNames() []string {
+	names := make([]string, 0, len(capabilityRegistry))
+	for name := range capabilityRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capNegotiation holds the state of an in-progress CAP negotiation for a
+// client that has not yet completed registration. While negotiating, any
+// replies the client would normally receive are buffered and released in
+// order once CAP END arrives.
+type capNegotiation struct {
+	negotiating bool
+	buffered    []Reply
+}
+
+func (state *capNegotiation) Buffer(reply Reply) {
+	state.buffered = append(state.buffered, reply)
+}
+
+func (state *capNegotiation) Flush() []Reply {
+	buffered := state.buffered
+	state.buffered = nil
+	state.negotiating = false
+	return buffered
+}
+
+// ProcessCapCommand handles a single CAP subcommand from client and returns
+// the replies it produces, in order.
+func ProcessCapCommand(client *Client, subCommand string, args []string) []Reply {
+	switch strings.ToUpper(subCommand) {
+	case "LS":
+		client.capState.negotiating = true
+		return []Reply{RplCap(client, "LS", strings.Join(registeredCapabilityNames(), " "))}
+
+	case "LIST":
+		return []Reply{RplCap(client, "LIST", strings.Join(client.Caps.Strings(), " "))}
+
+	case "REQ":
+		requested := strings.Fields(strings.Join(args, " "))
+		for _, name := range requested {
+			if _, ok := capabilityRegistry[name]; !ok {
+				// Per the CAP spec, a REQ is all-or-nothing: one unknown
+				// capability NAKs the whole line and changes nothing.
+				return []Reply{RplCap(client, "NAK", strings.Join(requested, " "))}
+			}
+		}
+		for _, name := range requested {
+			client.Caps.Enable(name)
+		}
+		return []Reply{RplCap(client, "ACK", strings.Join(requested, " "))}
+
+	case "END":
+		return client.capState.Flush()
+	}
+
+	return nil
+}
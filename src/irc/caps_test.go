@@ -0,0 +1,73 @@
+package irc
+
+import "testing"
+
+func TestCapSetHasEnableDisable(t *testing.T) {
+	caps := NewCapSet()
+	if caps.Has(CapBatch) {
+		t.Fatalf("fresh CapSet should not have %s enabled", CapBatch)
+	}
+
+	caps.Enable(CapBatch)
+	if !caps.Has(CapBatch) {
+		t.Fatalf("expected %s to be enabled after Enable", CapBatch)
+	}
+
+	caps.Disable(CapBatch)
+	if caps.Has(CapBatch) {
+		t.Fatalf("expected %s to be disabled after Disable", CapBatch)
+	}
+}
+
+func TestCapSetHasOnNil(t *testing.T) {
+	var caps *CapSet
+	if caps.Has(CapBatch) {
+		t.Fatalf("a nil CapSet must report no capabilities, not panic or false-enable")
+	}
+}
+
+func TestProcessCapCommandReqIsAllOrNothing(t *testing.T) {
+	client := NewClient(NewServer("test"))
+
+	ProcessCapCommand(client, "REQ", []string{CapBatch + " bogus-cap"})
+
+	if client.Caps.Has(CapBatch) {
+		t.Fatalf("REQ with one unknown capability must NAK the whole line and enable nothing, but %s was enabled", CapBatch)
+	}
+}
+
+func TestProcessCapCommandReqEnablesWhenAllKnown(t *testing.T) {
+	client := NewClient(NewServer("test"))
+
+	ProcessCapCommand(client, "REQ", []string{CapBatch + " " + CapMessageTags})
+
+	if !client.Caps.Has(CapBatch) || !client.Caps.Has(CapMessageTags) {
+		t.Fatalf("REQ with only known capabilities must enable all of them")
+	}
+}
+
+func TestProcessCapCommandLsStartsNegotiating(t *testing.T) {
+	client := NewClient(NewServer("test"))
+
+	ProcessCapCommand(client, "LS", nil)
+
+	if !client.capState.negotiating {
+		t.Fatalf("CAP LS must put the client into negotiation so replies are buffered until CAP END")
+	}
+}
+
+func TestProcessCapCommandEndFlushesBuffered(t *testing.T) {
+	client := NewClient(NewServer("test"))
+	ProcessCapCommand(client, "LS", nil)
+
+	buffered := NewStringReply(client.server, "X", "buffered")
+	client.capState.Buffer(buffered)
+
+	flushed := ProcessCapCommand(client, "END", nil)
+	if len(flushed) != 1 || flushed[0] != Reply(buffered) {
+		t.Fatalf("CAP END must flush exactly what was buffered during negotiation, got %v", flushed)
+	}
+	if client.capState.negotiating {
+		t.Fatalf("CAP END must end negotiation")
+	}
+}
@@ -0,0 +1,51 @@
+package irc
+
+import "time"
+
+// Channel is a named group of clients sharing messages, modes and, since
+// chunk0-5, a replayable history of recent events.
+type Channel struct {
+	server  *Server
+	name    string
+	topic   string
+	members map[*Client]bool
+
+	history *HistoryBuffer
+}
+
+func NewChannel(server *Server, name string) *Channel {
+	channel := &Channel{
+		server:  server,
+		name:    name,
+		members: make(map[*Client]bool),
+		history: NewHistoryBuffer(DefaultHistorySize),
+	}
+	server.channels[name] = channel
+	return channel
+}
+
+func (channel *Channel) Id() string {
+	return channel.name
+}
+
+func (channel *Channel) PublicId() string {
+	return channel.name
+}
+
+func (channel *Channel) Nick() string {
+	return channel.name
+}
+
+func (channel *Channel) Nicks() []string {
+	nicks := make([]string, 0, len(channel.members))
+	for member := range channel.members {
+		nicks = append(nicks, member.Nick())
+	}
+	return nicks
+}
+
+// Record appends reply to the channel's history buffer under the given
+// timestamp, so it can later be replayed by CHATHISTORY.
+func (channel *Channel) Record(when time.Time, reply Reply) {
+	channel.history.Add(when, reply)
+}
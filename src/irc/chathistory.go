@@ -0,0 +1,206 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHistorySize is how many events HistoryBuffer keeps per channel
+	// unless a channel is configured otherwise.
+	DefaultHistorySize = 1024
+
+	// MaxHistoryReplay caps how many events a single CHATHISTORY request
+	// may return, regardless of how much history is buffered.
+	MaxHistoryReplay = 100
+)
+
+func init() {
+	RegisterCapability(CapChatHistory, 302)
+}
+
+const CapChatHistory = "draft/chathistory"
+
+// HistoryEvent is one buffered line of channel traffic, kept long enough
+// to be replayed by CHATHISTORY. seq is a monotonically increasing
+// insertion-order cursor; we page on it instead of Time so that replay is
+// unaffected by clock skew or adjustment.
+type HistoryEvent struct {
+	seq   uint64
+	Time  time.Time
+	Reply Reply
+}
+
+// HistoryBuffer is a fixed-size ring buffer of recent HistoryEvents for a
+// single channel. The zero value is not usable; use NewHistoryBuffer.
+type HistoryBuffer struct {
+	events  []HistoryEvent
+	size    int
+	nextSeq uint64
+}
+
+func NewHistoryBuffer(size int) *HistoryBuffer {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	return &HistoryBuffer{size: size}
+}
+
+// Add records reply as having happened at when, tagging it with the next
+// insertion-order sequence number.
+func (buf *HistoryBuffer) Add(when time.Time, reply Reply) {
+	event := HistoryEvent{seq: buf.nextSeq, Time: when, Reply: reply}
+	buf.nextSeq++
+
+	buf.events = append(buf.events, event)
+	if len(buf.events) > buf.size {
+		buf.events = buf.events[len(buf.events)-buf.size:]
+	}
+}
+
+// Latest returns the most recent limit events, oldest first.
+func (buf *HistoryBuffer) Latest(limit int) []HistoryEvent {
+	return capEvents(buf.events, limit, false)
+}
+
+// Before returns events with seq less than before, oldest first.
+func (buf *HistoryBuffer) Before(before uint64, limit int) []HistoryEvent {
+	var matched []HistoryEvent
+	for _, event := range buf.events {
+		if event.seq < before {
+			matched = append(matched, event)
+		}
+	}
+	return capEvents(matched, limit, false)
+}
+
+// After returns events with seq greater than after, oldest first. Unlike
+// Before/Latest, over-limit results keep the head (the events immediately
+// following the cursor), not the tail - a bouncer doing incremental
+// AFTER-replay needs the next events in sequence, not the channel's newest
+// regardless of cursor.
+func (buf *HistoryBuffer) After(after uint64, limit int) []HistoryEvent {
+	var matched []HistoryEvent
+	for _, event := range buf.events {
+		if event.seq > after {
+			matched = append(matched, event)
+		}
+	}
+	return capEvents(matched, limit, true)
+}
+
+// Between returns events with seq strictly between from and to, oldest first.
+func (buf *HistoryBuffer) Between(from, to uint64, limit int) []HistoryEvent {
+	var matched []HistoryEvent
+	for _, event := range buf.events {
+		if event.seq > from && event.seq < to {
+			matched = append(matched, event)
+		}
+	}
+	return capEvents(matched, limit, false)
+}
+
+// Around returns up to limit events centered on the event at seq, split
+// evenly between older and newer.
+func (buf *HistoryBuffer) Around(seq uint64, limit int) []HistoryEvent {
+	center := -1
+	for i, event := range buf.events {
+		if event.seq == seq {
+			center = i
+			break
+		}
+	}
+	if center < 0 {
+		return nil
+	}
+	half := limit / 2
+	start := center - half
+	if start < 0 {
+		start = 0
+	}
+	end := start + limit
+	if end > len(buf.events) {
+		end = len(buf.events)
+	}
+	return capEvents(buf.events[start:end], limit, false)
+}
+
+// capEvents trims events to at most limit entries. keepHead selects the
+// earliest entries (for forward, cursor-relative replay like After);
+// otherwise the latest entries are kept (closest to "now" or to the
+// cursor being paged backward from).
+func capEvents(events []HistoryEvent, limit int, keepHead bool) []HistoryEvent {
+	if limit <= 0 || limit > MaxHistoryReplay {
+		limit = MaxHistoryReplay
+	}
+	if len(events) <= limit {
+		return events
+	}
+	if keepHead {
+		return events[:limit]
+	}
+	return events[len(events)-limit:]
+}
+
+// channelVisibleTo reports whether client may read channel's history
+// without being a member: channels whose name ends in "-s" are treated as
+// open/searchable for history purposes even to non-members.
+func channelVisibleTo(channel *Channel, client *Client) bool {
+	if channel.members[client] {
+		return true
+	}
+	return strings.HasSuffix(channel.name, "-s")
+}
+
+// ChatHistoryCmd implements the CHATHISTORY command: LATEST, BEFORE,
+// AFTER, BETWEEN and AROUND, replaying matching events wrapped in a
+// "chathistory" BATCH tagged with the target channel.
+func ChatHistoryCmd(client *Client, subCommand string, target string, args []string) Reply {
+	if !client.Caps.Has(CapChatHistory) {
+		return ErrUnknownCommand(client.server, "CHATHISTORY")
+	}
+
+	channel := client.server.channels[target]
+	if channel == nil {
+		return ErrNoSuchChannel(client.server, target)
+	}
+	if !channelVisibleTo(channel, client) {
+		return ErrNotOnChannel(channel)
+	}
+
+	limit := MaxHistoryReplay
+	var events []HistoryEvent
+	switch subCommand {
+	case "LATEST":
+		events = channel.history.Latest(limit)
+	case "BEFORE":
+		events = channel.history.Before(parseHistorySeq(args), limit)
+	case "AFTER":
+		events = channel.history.After(parseHistorySeq(args), limit)
+	case "AROUND":
+		events = channel.history.Around(parseHistorySeq(args), limit)
+	case "BETWEEN":
+		if len(args) < 2 {
+			return ErrNeedMoreParams(client.server, "CHATHISTORY")
+		}
+		events = channel.history.Between(parseHistorySeq(args[:1]), parseHistorySeq(args[1:]), limit)
+	default:
+		return ErrUnknownCommand(client.server, "CHATHISTORY "+subCommand)
+	}
+
+	inner := make([]Reply, len(events))
+	for i, event := range events {
+		inner[i] = NewTimestampedReply(event.Reply, event.Time)
+	}
+	return NewBatchReply("chathistory", []string{target}, inner)
+}
+
+func parseHistorySeq(args []string) uint64 {
+	if len(args) == 0 {
+		return 0
+	}
+	var seq uint64
+	fmt.Sscanf(args[0], "%d", &seq)
+	return seq
+}
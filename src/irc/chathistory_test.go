@@ -0,0 +1,145 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func fillBuffer(buf *HistoryBuffer, n int) {
+	for i := 0; i < n; i++ {
+		buf.Add(time.Unix(int64(i), 0), newFakeLine("event"))
+	}
+}
+
+func seqs(events []HistoryEvent) []uint64 {
+	out := make([]uint64, len(events))
+	for i, event := range events {
+		out[i] = event.seq
+	}
+	return out
+}
+
+func TestHistoryBufferIsARingBuffer(t *testing.T) {
+	buf := NewHistoryBuffer(3)
+	fillBuffer(buf, 5)
+
+	got := seqs(buf.Latest(10))
+	want := []uint64{2, 3, 4}
+	if !equalSeqs(got, want) {
+		t.Fatalf("ring buffer of size 3 after 5 adds should keep the last 3 seqs, got %v, want %v", got, want)
+	}
+}
+
+func TestHistoryBufferAfterKeepsHeadNotTail(t *testing.T) {
+	buf := NewHistoryBuffer(1000)
+	fillBuffer(buf, 250)
+
+	got := seqs(buf.After(0, 100))
+
+	if len(got) != 100 {
+		t.Fatalf("expected 100 events, got %d", len(got))
+	}
+	if got[0] != 1 || got[len(got)-1] != 100 {
+		t.Fatalf("After(0, 100) over 250 events must return seqs 1..100 (the head of the match), got %d..%d", got[0], got[len(got)-1])
+	}
+}
+
+func TestHistoryBufferBeforeKeepsTail(t *testing.T) {
+	buf := NewHistoryBuffer(1000)
+	fillBuffer(buf, 250)
+
+	got := seqs(buf.Before(200, 100))
+
+	if len(got) != 100 {
+		t.Fatalf("expected 100 events, got %d", len(got))
+	}
+	if got[0] != 100 || got[len(got)-1] != 199 {
+		t.Fatalf("Before(200, 100) over 250 events must return the 100 events closest to the cursor (seqs 100..199), got %d..%d", got[0], got[len(got)-1])
+	}
+}
+
+func TestHistoryBufferAround(t *testing.T) {
+	buf := NewHistoryBuffer(1000)
+	fillBuffer(buf, 50)
+
+	got := seqs(buf.Around(25, 10))
+	if len(got) == 0 {
+		t.Fatalf("Around an existing seq must return events")
+	}
+	found := false
+	for _, seq := range got {
+		if seq == 25 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Around(25, 10) should include the centered event itself, got %v", got)
+	}
+}
+
+func TestHistoryBufferAroundMissingSeq(t *testing.T) {
+	buf := NewHistoryBuffer(10)
+	fillBuffer(buf, 5)
+
+	got := buf.Around(999, 10)
+	if got != nil {
+		t.Fatalf("Around a seq that was never recorded should return nothing, got %v", got)
+	}
+}
+
+func TestCapEventsCapsAtMaxHistoryReplay(t *testing.T) {
+	events := make([]HistoryEvent, MaxHistoryReplay+50)
+	for i := range events {
+		events[i] = HistoryEvent{seq: uint64(i)}
+	}
+
+	got := capEvents(events, 0, false)
+	if len(got) != MaxHistoryReplay {
+		t.Fatalf("a non-positive limit should fall back to MaxHistoryReplay, got %d events", len(got))
+	}
+
+	got = capEvents(events, MaxHistoryReplay+1000, false)
+	if len(got) != MaxHistoryReplay {
+		t.Fatalf("a limit above MaxHistoryReplay should be clamped, got %d events", len(got))
+	}
+}
+
+func TestChatHistoryCmdRequiresCapability(t *testing.T) {
+	server := NewServer("test")
+	channel := NewChannel(server, "#chan")
+	client := NewClient(server)
+	channel.members[client] = true
+
+	reply := ChatHistoryCmd(client, "LATEST", "#chan", nil)
+	lines := collectLines(t, client, reply)
+	if len(lines) != 1 {
+		t.Fatalf("expected a single error line when draft/chathistory isn't negotiated, got %v", lines)
+	}
+}
+
+func TestChatHistoryCmdServesWithCapability(t *testing.T) {
+	server := NewServer("test")
+	channel := NewChannel(server, "#chan")
+	client := NewClient(server)
+	client.Caps.Enable(CapChatHistory)
+	channel.members[client] = true
+	channel.history.Add(time.Unix(0, 0), newFakeLine("hi"))
+
+	reply := ChatHistoryCmd(client, "LATEST", "#chan", nil)
+	lines := collectLines(t, client, reply)
+	if len(lines) == 0 {
+		t.Fatalf("expected CHATHISTORY LATEST to return the one recorded event (unwrapped, as the client lacks the batch capability)")
+	}
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package irc
+
+// Client represents a single connection registering or registered with
+// the server.
+type Client struct {
+	server *Server
+	nick   string
+
+	replies chan Reply
+
+	Caps     *CapSet
+	capState capNegotiation
+}
+
+func NewClient(server *Server) *Client {
+	return &Client{
+		server:  server,
+		replies: make(chan Reply),
+		Caps:    NewCapSet(),
+	}
+}
+
+func (client *Client) Id() string {
+	return client.nickOrStar() + "!user@host"
+}
+
+func (client *Client) PublicId() string {
+	return client.nickOrStar()
+}
+
+func (client *Client) Nick() string {
+	return client.nick
+}
+
+// nickOrStar is the nick to use in replies sent before registration
+// completes, per RFC 2812's use of "*" for an as-yet-unknown nick.
+func (client *Client) nickOrStar() string {
+	if client.nick == "" {
+		return "*"
+	}
+	return client.nick
+}
+
+func (client *Client) UModeString() string {
+	return "+"
+}
+
+func (client *Client) Replies() chan<- Reply {
+	return client.replies
+}
+
+// CompleteRegistration sends the post-registration welcome burst, ending
+// with the RPL_ISUPPORT (005) lines describing this server's features.
+func (client *Client) CompleteRegistration() {
+	client.SendLabeled(nil,
+		RplWelcome(client.server, client),
+		RplYourHost(client.server),
+		RplCreated(client.server),
+		RplMyInfo(client.server))
+	client.SendLabeled(nil, RplISupport(client.server, client)...)
+}
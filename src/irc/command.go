@@ -0,0 +1,48 @@
+package irc
+
+import "strings"
+
+// Dispatch routes one parsed command line to its handler, applies
+// labeled-response correlation (chunk0-4) if the line carried a label
+// tag, and - while the client is mid CAP negotiation - buffers the
+// resulting replies instead of sending them immediately, per CAP LS
+// holding the registration burst until CAP END.
+func (client *Client) Dispatch(command string, label string, params []string) {
+	ctx := &ReplyContext{Label: label}
+
+	// CAP's own replies are negotiation itself, not something to hold
+	// back until negotiation finishes.
+	if strings.ToUpper(command) == "CAP" {
+		if len(params) == 0 {
+			return
+		}
+		replies := ProcessCapCommand(client, params[0], params[1:])
+		client.SendLabeled(ctx, replies...)
+		return
+	}
+
+	replies := client.handle(command, params)
+
+	if client.capState.negotiating {
+		for _, reply := range ApplyLabel(ctx, client.server, replies) {
+			client.capState.Buffer(reply)
+		}
+		return
+	}
+	client.SendLabeled(ctx, replies...)
+}
+
+// handle runs the handler for command and returns the replies it
+// produced, unlabeled and unbuffered.
+func (client *Client) handle(command string, params []string) []Reply {
+	switch strings.ToUpper(command) {
+	case "CHATHISTORY":
+		if len(params) < 2 {
+			return []Reply{ErrNeedMoreParams(client.server, "CHATHISTORY")}
+		}
+		return []Reply{ChatHistoryCmd(client, strings.ToUpper(params[0]), params[1], params[2:])}
+
+	default:
+		return []Reply{ErrUnknownCommand(client.server, command)}
+	}
+}
@@ -0,0 +1,88 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ISupportTokens is the live RPL_ISUPPORT (005) token set for a server.
+// Subsystems mutate it at startup as they come online (e.g. channel modes
+// registering CHANMODES, the config loader setting NETWORK), and RplISupport
+// reads a consistent snapshot of it during client registration.
+type ISupportTokens struct {
+	values map[string]string
+	order  []string
+}
+
+func NewISupportTokens() *ISupportTokens {
+	return &ISupportTokens{values: make(map[string]string)}
+}
+
+// Set adds or replaces the value for token. An empty value produces a
+// valueless token (e.g. "EXCEPTS" rather than "EXCEPTS=").
+func (tokens *ISupportTokens) Set(token string, value string) {
+	if _, exists := tokens.values[token]; !exists {
+		tokens.order = append(tokens.order, token)
+	}
+	tokens.values[token] = value
+}
+
+// Strings renders each token as it appears on the wire, in the order
+// tokens were first set.
+func (tokens *ISupportTokens) Strings() []string {
+	rendered := make([]string, len(tokens.order))
+	for i, token := range tokens.order {
+		if value := tokens.values[token]; value != "" {
+			rendered[i] = fmt.Sprintf("%s=%s", token, value)
+		} else {
+			rendered[i] = token
+		}
+	}
+	return rendered
+}
+
+// DefaultISupportTokens returns the baseline 005 tokens every server
+// advertises; callers add to or override these as their own features are
+// configured.
+func DefaultISupportTokens() *ISupportTokens {
+	tokens := NewISupportTokens()
+	tokens.Set("CHANTYPES", "#")
+	tokens.Set("PREFIX", "(ov)@+")
+	tokens.Set("CHANMODES", "b,k,l,imnpst")
+	tokens.Set("CASEMAPPING", "ascii")
+	tokens.Set("NICKLEN", "32")
+	tokens.Set("CHANNELLEN", "64")
+	tokens.Set("TOPICLEN", "390")
+	tokens.Set("AWAYLEN", "307")
+	tokens.Set("MAXTARGETS", "4")
+	tokens.Set("ELIST", "U")
+	tokens.Set("NETWORK", "ergo")
+	return tokens
+}
+
+const isupportTrailer = ":are supported by this server"
+
+// RplISupport renders server's ISupportTokens as one or more RPL_ISUPPORT
+// (005) replies, splitting tokens across lines so each stays under
+// MAX_REPLY_LEN.
+func RplISupport(server *Server, client *Client) []Reply {
+	remaining := server.isupport.Strings()
+
+	base := NewNumericReply(server, RPL_ISUPPORT, isupportTrailer)
+	baseLen := len(base.FormatString(client))
+
+	var replies []Reply
+	for len(remaining) > 0 {
+		end := 1
+		// +1 for the space the real line inserts between the joined
+		// tokens and isupportTrailer, which the zero-token baseLen probe
+		// never paid for.
+		for end < len(remaining) && (baseLen+joinedLen(remaining[:end+1])+1) <= MAX_REPLY_LEN {
+			end++
+		}
+		replies = append(replies, NewNumericReply(server, RPL_ISUPPORT, "%s %s",
+			strings.Join(remaining[:end], " "), isupportTrailer))
+		remaining = remaining[end:]
+	}
+	return replies
+}
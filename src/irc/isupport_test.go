@@ -0,0 +1,85 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestISupportTokensStringsPreservesOrderAndValueless(t *testing.T) {
+	tokens := NewISupportTokens()
+	tokens.Set("CHANTYPES", "#")
+	tokens.Set("EXCEPTS", "")
+	tokens.Set("PREFIX", "(ov)@+")
+
+	got := tokens.Strings()
+	want := []string{"CHANTYPES=#", "EXCEPTS", "PREFIX=(ov)@+"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Strings()[%d] = %q, want %q (full: %v)", i, got[i], want[i], got)
+		}
+	}
+}
+
+func TestISupportTokensSetOverwritesInPlace(t *testing.T) {
+	tokens := NewISupportTokens()
+	tokens.Set("NICKLEN", "9")
+	tokens.Set("NICKLEN", "32")
+
+	got := tokens.Strings()
+	if len(got) != 1 || got[0] != "NICKLEN=32" {
+		t.Fatalf("re-setting a token must overwrite its value without duplicating it, got %v", got)
+	}
+}
+
+func TestRplISupportSplitsUnderMaxReplyLen(t *testing.T) {
+	server := NewServer("test")
+	server.isupport = NewISupportTokens()
+	// A run of tokens long enough to force at least two 005 lines.
+	for i := 0; i < 40; i++ {
+		server.isupport.Set("TOKEN"+strconv.Itoa(i), "0123456789")
+	}
+	client := NewClient(server)
+	client.nick = "someone"
+
+	replies := RplISupport(server, client)
+	if len(replies) < 2 {
+		t.Fatalf("expected the tokens to be split across multiple 005 lines, got %d", len(replies))
+	}
+
+	for _, reply := range replies {
+		lines := collectLines(t, client, reply)
+		for _, line := range lines {
+			if len(line) > MAX_REPLY_LEN {
+				t.Errorf("005 line exceeds MAX_REPLY_LEN (%d): %d bytes: %q", MAX_REPLY_LEN, len(line), line)
+			}
+			if !strings.HasSuffix(line, isupportTrailer) {
+				t.Errorf("005 line missing trailer: %q", line)
+			}
+		}
+	}
+}
+
+func TestRplISupportEveryTokenIsSentExactlyOnce(t *testing.T) {
+	server := NewServer("test")
+	server.isupport = NewISupportTokens()
+	for i := 0; i < 25; i++ {
+		server.isupport.Set("TOKEN"+strconv.Itoa(i), "value")
+	}
+	client := NewClient(server)
+
+	seen := make(map[string]int)
+	for _, reply := range RplISupport(server, client) {
+		for _, line := range collectLines(t, client, reply) {
+			for _, token := range strings.Fields(strings.TrimSuffix(line, isupportTrailer)) {
+				seen[token]++
+			}
+		}
+	}
+
+	for _, token := range server.isupport.Strings() {
+		if seen[token] != 1 {
+			t.Errorf("token %q was sent %d times across the 005 lines, want exactly once", token, seen[token])
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	RegisterCapability(CapLabeledResponse, 302)
+}
+
+// ReplyContext carries the bits of the command currently being handled
+// that the reply layer needs but that aren't part of any one Reply -
+// right now just the label attached by IRCv3 labeled-response, if any.
+type ReplyContext struct {
+	Label string
+}
+
+// RplAck is the standalone "ACK" reply labeled-response synthesizes when a
+// command produced no other replies, so the client still has something to
+// correlate its label against.
+func RplAck(source Identifier) Reply {
+	return &StringReply{
+		BaseReply: &BaseReply{source: source, message: fmt.Sprintf(":%s ACK", source.Id())},
+		code:      "ACK",
+	}
+}
+
+// labeledReply tags an existing reply's rendered line with a label,
+// without mutating the wrapped reply itself - replies can be long-lived
+// and shared (e.g. a CHATHISTORY ring buffer entry replayed to many
+// clients), so stamping a label permanently onto one via AddTag would leak
+// across requests.
+type labeledReply struct {
+	Reply
+	label string
+}
+
+func (reply *labeledReply) Format(client *Client, write chan<- string) {
+	prefix := formatTags(client, []Tag{{Key: "label", Value: reply.label}})
+	if prefix == "" {
+		reply.Reply.Format(client, write)
+		return
+	}
+	tag := strings.TrimSuffix(strings.TrimPrefix(prefix, "@"), " ")
+
+	inner := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range inner {
+			write <- prependTag(line, tag)
+		}
+	}()
+	reply.Reply.Format(client, inner)
+	close(inner)
+	<-done
+}
+
+func withLabel(reply Reply, label string) Reply {
+	return &labeledReply{Reply: reply, label: label}
+}
+
+// ApplyLabel stamps replies with ctx's label, per the labeled-response
+// spec: a single reply is tagged directly, several are each tagged and
+// wrapped in a "labeled-response" BATCH also tagged on the wrapper (so a
+// batch-capable client gets one correlator on the envelope, and a client
+// without the batch capability - which sees the BatchReply fall back to
+// emitting its inner replies unwrapped - still gets the label on every
+// line), and zero replies become a standalone tagged ACK so the client
+// still gets a correlator. If ctx is nil or carries no label, replies are
+// returned unchanged.
+func ApplyLabel(ctx *ReplyContext, source Identifier, replies []Reply) []Reply {
+	if ctx == nil || ctx.Label == "" {
+		return replies
+	}
+
+	switch len(replies) {
+	case 0:
+		return []Reply{withLabel(RplAck(source), ctx.Label)}
+	case 1:
+		return []Reply{withLabel(replies[0], ctx.Label)}
+	default:
+		tagged := make([]Reply, len(replies))
+		for i, reply := range replies {
+			tagged[i] = withLabel(reply, ctx.Label)
+		}
+		// The batch is built here for this request alone, so tagging it in
+		// place labels only its BATCH start line.
+		batch := NewBatchReply("labeled-response", nil, tagged)
+		return []Reply{WithTag(batch, "label", ctx.Label)}
+	}
+}
+
+// SendLabeled applies ctx's label (if any) to replies and pushes the
+// result onto the client's reply channel, in order.
+func (client *Client) SendLabeled(ctx *ReplyContext, replies ...Reply) {
+	for _, reply := range ApplyLabel(ctx, client.server, replies) {
+		client.Replies() <- reply
+	}
+}
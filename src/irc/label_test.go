@@ -0,0 +1,86 @@
+package irc
+
+import "testing"
+
+func capableClient() *Client {
+	client := NewClient(NewServer("test"))
+	client.Caps.Enable(CapMessageTags)
+	client.Caps.Enable(CapLabeledResponse)
+	return client
+}
+
+func TestApplyLabelNilContextIsNoop(t *testing.T) {
+	replies := []Reply{newFakeLine("a"), newFakeLine("b")}
+	got := ApplyLabel(nil, NewServer("test"), replies)
+	if len(got) != len(replies) {
+		t.Fatalf("a nil context must return replies unchanged, got %d replies", len(got))
+	}
+}
+
+func TestApplyLabelZeroRepliesSynthesizesAck(t *testing.T) {
+	client := capableClient()
+	ctx := &ReplyContext{Label: "l1"}
+
+	got := ApplyLabel(ctx, client.server, nil)
+	if len(got) != 1 {
+		t.Fatalf("expected a single synthesized ACK, got %d replies", len(got))
+	}
+
+	lines := collectLines(t, client, got[0])
+	if len(lines) != 1 || !hasTag(lines[0], "label") {
+		t.Fatalf("synthesized ACK must carry the label tag, got %v", lines)
+	}
+}
+
+func TestApplyLabelSingleReplyIsTaggedDirectly(t *testing.T) {
+	client := capableClient()
+	ctx := &ReplyContext{Label: "l1"}
+
+	got := ApplyLabel(ctx, client.server, []Reply{newFakeLine("only line")})
+	lines := collectLines(t, client, got[0])
+	if len(lines) != 1 || !hasTag(lines[0], "label") {
+		t.Fatalf("the single reply must itself carry the label tag, got %v", lines)
+	}
+}
+
+func TestApplyLabelMultipleRepliesTagEachLine(t *testing.T) {
+	client := capableClient()
+	client.Caps.Enable(CapBatch)
+	ctx := &ReplyContext{Label: "l1"}
+
+	got := ApplyLabel(ctx, client.server, []Reply{newFakeLine("one"), newFakeLine("two")})
+	if len(got) != 1 {
+		t.Fatalf("multiple replies must be wrapped into a single labeled-response BATCH, got %d", len(got))
+	}
+
+	lines := collectLines(t, client, got[0])
+	// The BATCH start line and both inner lines should all carry the label,
+	// so a client that can't see the batch framing still gets it on every
+	// line it does see.
+	tagged := 0
+	for _, line := range lines {
+		if hasTag(line, "label") {
+			tagged++
+		}
+	}
+	if tagged < 3 {
+		t.Fatalf("expected the BATCH start line and both inner lines to carry the label, got %d tagged lines out of %v", tagged, lines)
+	}
+}
+
+func TestApplyLabelMultipleRepliesWithoutBatchCapStillTagsEachLine(t *testing.T) {
+	client := capableClient() // no CapBatch
+
+	ctx := &ReplyContext{Label: "l1"}
+	got := ApplyLabel(ctx, client.server, []Reply{newFakeLine("one"), newFakeLine("two")})
+
+	lines := collectLines(t, client, got[0])
+	if len(lines) != 2 {
+		t.Fatalf("without the batch capability, the wrapper must fall back to unwrapped inner lines, got %v", lines)
+	}
+	for _, line := range lines {
+		if !hasTag(line, "label") {
+			t.Errorf("inner line missing label tag when batch capability isn't negotiated: %q", line)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package irc
 
 import (
+	"crypto/rand"
 	"fmt"
 	"strings"
 	"time"
@@ -21,15 +22,100 @@ type Reply interface {
 	Source() Identifier
 }
 
+// Tag is a single IRCv3 message tag (the "key=value" piece of an
+// "@key=value;key2=value2 " prefix).
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Tagger is implemented by replies that can carry IRCv3 message tags.
+type Tagger interface {
+	Tags() []Tag
+	AddTag(key, value string)
+}
+
+// WithTag attaches an IRCv3 message tag to reply, if reply supports tags,
+// and returns reply so calls can be chained at the call site.
+func WithTag(reply Reply, key, value string) Reply {
+	if tagger, ok := reply.(Tagger); ok {
+		tagger.AddTag(key, value)
+	}
+	return reply
+}
+
+// Capability names referenced when deciding whether a tag may be shown to
+// a given client. The capability negotiation itself lives elsewhere; this
+// is just the vocabulary the reply layer needs.
+const (
+	CapMessageTags     = "message-tags"
+	CapServerTime      = "server-time"
+	CapAccountTag      = "account-tag"
+	CapBatch           = "batch"
+	CapLabeledResponse = "labeled-response"
+)
+
+// tagCapabilities maps a tag key to the capability that must be negotiated
+// before that tag may be shown, beyond the base CapMessageTags requirement.
+// Tags not listed here are shown to any client with CapMessageTags. The
+// batch=<ref> tag on lines inside a BATCH is written by BatchReply itself
+// and is shown to any client with CapBatch, with or without CapMessageTags.
+var tagCapabilities = map[string]string{
+	"time":    CapServerTime,
+	"account": CapAccountTag,
+	"label":   CapLabeledResponse,
+	"batch":   CapBatch,
+}
+
+// formatTags renders the "@key=value;..." prefix (including the trailing
+// space) for the tags a client is entitled to see, or "" if none apply.
+func formatTags(client *Client, tags []Tag) string {
+	if len(tags) == 0 || client == nil || !client.Caps.Has(CapMessageTags) {
+		return ""
+	}
+	parts := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if required, ok := tagCapabilities[tag.Key]; ok && !client.Caps.Has(required) {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", tag.Key, escapeTagValue(tag.Value)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "@" + strings.Join(parts, ";") + " "
+}
+
+var tagValueEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+func escapeTagValue(value string) string {
+	return tagValueEscaper.Replace(value)
+}
+
 type BaseReply struct {
 	source  Identifier
 	message string
+	tags    []Tag
 }
 
 func (reply *BaseReply) Source() Identifier {
 	return reply.source
 }
 
+func (reply *BaseReply) Tags() []Tag {
+	return reply.tags
+}
+
+func (reply *BaseReply) AddTag(key, value string) {
+	reply.tags = append(reply.tags, Tag{key, value})
+}
+
 type StringReply struct {
 	*BaseReply
 	code string
@@ -40,13 +126,13 @@ func NewStringReply(source Identifier, code string,
 	message := fmt.Sprintf(format, args...)
 	fullMessage := fmt.Sprintf(":%s %s %s", source.Id(), code, message)
 	return &StringReply{
-		BaseReply: &BaseReply{source, fullMessage},
+		BaseReply: &BaseReply{source: source, message: fullMessage},
 		code:      code,
 	}
 }
 
 func (reply *StringReply) Format(client *Client, write chan<- string) {
-	write <- reply.message
+	write <- formatTags(client, reply.tags) + reply.message
 }
 
 func (reply *StringReply) String() string {
@@ -62,7 +148,7 @@ type NumericReply struct {
 func NewNumericReply(source Identifier, code int, format string,
 	args ...interface{}) *NumericReply {
 	return &NumericReply{
-		BaseReply: &BaseReply{source, fmt.Sprintf(format, args...)},
+		BaseReply: &BaseReply{source: source, message: fmt.Sprintf(format, args...)},
 		code:      code,
 	}
 }
@@ -72,8 +158,8 @@ func (reply *NumericReply) Format(client *Client, write chan<- string) {
 }
 
 func (reply *NumericReply) FormatString(client *Client) string {
-	return fmt.Sprintf(":%s %03d %s %s", reply.Source().Id(), reply.code,
-		client.Nick(), reply.message)
+	return fmt.Sprintf("%s:%s %03d %s %s", formatTags(client, reply.tags),
+		reply.Source().Id(), reply.code, client.Nick(), reply.message)
 }
 
 func (reply *NumericReply) String() string {
@@ -115,18 +201,142 @@ func (reply *NamesReply) Format(client *Client, write chan<- string) {
 	tooLong := func(names []string) bool {
 		return (baseLen + joinedLen(names)) > MAX_REPLY_LEN
 	}
+	var inner []Reply
 	var start = 0
 	nicks := reply.channel.Nicks()
 	for i := range nicks {
 		if (i > start) && tooLong(nicks[start:i]) {
-			RplNamReply(reply.channel, nicks[start:i-1]).Format(client, write)
+			inner = append(inner, RplNamReply(reply.channel, nicks[start:i-1]))
 			start = i - 1
 		}
 	}
 	if start < (len(nicks) - 1) {
-		RplNamReply(reply.channel, nicks[start:]).Format(client, write)
+		inner = append(inner, RplNamReply(reply.channel, nicks[start:]))
 	}
-	RplEndOfNames(reply.channel).Format(client, write)
+	inner = append(inner, RplEndOfNames(reply.channel))
+
+	NewBatchReply("names", []string{reply.channel.name}, inner).Format(client, write)
+}
+
+// batch replies
+
+// BatchReply groups a set of inner replies inside an IRCv3 BATCH, for
+// clients that negotiated the batch capability. Clients without it just
+// see the inner replies one after another, unchanged.
+type BatchReply struct {
+	*BaseReply
+	batchType string
+	params    []string
+	inner     []Reply
+}
+
+// NewBatchReply wraps inner in a BATCH of the given type, with params
+// appended after the type (e.g. a channel name for a NAMES batch).
+func NewBatchReply(batchType string, params []string, inner []Reply) Reply {
+	return &BatchReply{
+		BaseReply: &BaseReply{},
+		batchType: batchType,
+		params:    params,
+		inner:     inner,
+	}
+}
+
+func (reply *BatchReply) Format(client *Client, write chan<- string) {
+	if !client.Caps.Has(CapBatch) {
+		for _, inner := range reply.inner {
+			inner.Format(client, write)
+		}
+		return
+	}
+
+	ref := newBatchRef(client)
+	header := fmt.Sprintf(":%s BATCH +%s %s", client.server.Id(), ref, reply.batchType)
+	if len(reply.params) > 0 {
+		header += " " + strings.Join(reply.params, " ")
+	}
+	write <- formatTags(client, reply.tags) + header
+
+	// Every line belonging to the batch - other than the start/end framing
+	// itself - must carry a batch=<ref> tag so the client can tell it apart
+	// from unrelated traffic interleaved on the same connection.
+	batchTag := fmt.Sprintf("batch=%s", ref)
+	inner := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range inner {
+			write <- prependTag(line, batchTag)
+		}
+	}()
+	for _, item := range reply.inner {
+		item.Format(client, inner)
+	}
+	close(inner)
+	<-done
+
+	write <- fmt.Sprintf(":%s BATCH -%s", client.server.Id(), ref)
+}
+
+// newBatchRef generates a batch reference token. It's prefixed with the
+// client's own id so that tokens can't collide across different clients'
+// concurrent batches, and suffixed with random bytes so they can't collide
+// within a single client's either.
+func newBatchRef(client *Client) string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	return fmt.Sprintf("%s-%x", client.Id(), suffix)
+}
+
+// TimestampedReply wraps another reply with an IRCv3 "time" tag carrying a
+// specific timestamp, rather than the moment Format happens to run. This is
+// what lets CHATHISTORY replay past events with their original time and
+// still gate the tag on the server-time capability like any other tag.
+type TimestampedReply struct {
+	Reply
+	timestamp time.Time
+}
+
+func NewTimestampedReply(reply Reply, timestamp time.Time) Reply {
+	return &TimestampedReply{Reply: reply, timestamp: timestamp}
+}
+
+func (reply *TimestampedReply) Format(client *Client, write chan<- string) {
+	// Route through formatTags so "time" gets the same CapMessageTags +
+	// tagCapabilities[...] gating formatTags gives reply tags, rather than only
+	// checking CapServerTime and leaving a client that negotiated
+	// server-time without message-tags able to see a raw, unparseable
+	// "@time=..." prefix it never agreed to.
+	prefix := formatTags(client, []Tag{{Key: "time", Value: reply.timestamp.UTC().Format("2006-01-02T15:04:05.000Z")}})
+	if prefix == "" {
+		reply.Reply.Format(client, write)
+		return
+	}
+	timeTag := strings.TrimSuffix(strings.TrimPrefix(prefix, "@"), " ")
+
+	inner := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range inner {
+			write <- prependTag(line, timeTag)
+		}
+	}()
+	reply.Reply.Format(client, inner)
+	close(inner)
+	<-done
+}
+
+// prependTag inserts tag as the first entry of line's existing "@..." tag
+// prefix, or adds a new one if line doesn't have one yet.
+func prependTag(line string, tag string) string {
+	if !strings.HasPrefix(line, "@") {
+		return "@" + tag + " " + line
+	}
+	spaceIdx := strings.Index(line, " ")
+	if spaceIdx < 0 {
+		return "@" + tag + ";" + line[1:]
+	}
+	return "@" + tag + ";" + line[1:spaceIdx] + line[spaceIdx:]
 }
 
 // messaging replies
@@ -214,6 +424,11 @@ func RplEndOfNames(source Identifier) Reply {
 		":End of NAMES list")
 }
 
+func RplCap(client *Client, subCommand string, args string) Reply {
+	return NewStringReply(client.server, RPL_CAP, "%s %s :%s",
+		client.nickOrStar(), subCommand, args)
+}
+
 func RplYoureOper(server *Server) Reply {
 	return NewNumericReply(server, RPL_YOUREOPER,
 		":You are now an IRC operator")
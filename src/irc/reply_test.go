@@ -0,0 +1,140 @@
+package irc
+
+import "testing"
+
+func TestEscapeTagValue(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"plain", "plain"},
+		{"has space", "has\\sspace"},
+		{"semi;colon", "semi\\:colon"},
+		{"back\\slash", "back\\\\slash"},
+		{"line\r\nbreak", "line\\r\\nbreak"},
+	}
+	for _, test := range tests {
+		if got := escapeTagValue(test.in); got != test.out {
+			t.Errorf("escapeTagValue(%q) = %q, want %q", test.in, got, test.out)
+		}
+	}
+}
+
+func TestFormatTagsRequiresMessageTags(t *testing.T) {
+	client := NewClient(NewServer("test"))
+	client.Caps.Enable(CapServerTime)
+
+	tags := []Tag{{Key: "time", Value: "2026-01-01T00:00:00.000Z"}}
+	if got := formatTags(client, tags); got != "" {
+		t.Fatalf("formatTags without message-tags negotiated should suppress every tag, got %q", got)
+	}
+}
+
+func TestFormatTagsGatesPerTagCapability(t *testing.T) {
+	client := NewClient(NewServer("test"))
+	client.Caps.Enable(CapMessageTags)
+
+	tags := []Tag{
+		{Key: "time", Value: "2026-01-01T00:00:00.000Z"},
+		{Key: "account", Value: "alice"},
+	}
+
+	got := formatTags(client, tags)
+	if got != "" {
+		t.Fatalf("neither server-time nor account-tag is negotiated, expected no tags, got %q", got)
+	}
+
+	client.Caps.Enable(CapServerTime)
+	got = formatTags(client, tags)
+	if got != "@time=2026-01-01T00:00:00.000Z " {
+		t.Fatalf("expected only the time tag once server-time is negotiated, got %q", got)
+	}
+}
+
+func TestWithTagAddsTagViaTagger(t *testing.T) {
+	reply := NewStringReply(NewServer("test"), "X", "hello")
+	WithTag(reply, "label", "abc123")
+
+	tags := reply.Tags()
+	if len(tags) != 1 || tags[0].Key != "label" || tags[0].Value != "abc123" {
+		t.Fatalf("expected a single label tag, got %v", tags)
+	}
+}
+
+func TestPrependTagAddsNewPrefix(t *testing.T) {
+	got := prependTag(":server PRIVMSG #chan :hi", "batch=abc")
+	want := "@batch=abc :server PRIVMSG #chan :hi"
+	if got != want {
+		t.Fatalf("prependTag() = %q, want %q", got, want)
+	}
+}
+
+func TestPrependTagMergesWithExistingPrefix(t *testing.T) {
+	got := prependTag("@time=2026-01-01T00:00:00.000Z :server PRIVMSG #chan :hi", "batch=abc")
+	want := "@batch=abc;time=2026-01-01T00:00:00.000Z :server PRIVMSG #chan :hi"
+	if got != want {
+		t.Fatalf("prependTag() = %q, want %q", got, want)
+	}
+}
+
+// fakeLine is a minimal Reply that writes a single fixed line, used to
+// exercise BatchReply without needing a fully wired numeric reply.
+type fakeLine struct {
+	*BaseReply
+	line string
+}
+
+func newFakeLine(line string) Reply {
+	return &fakeLine{BaseReply: &BaseReply{}, line: line}
+}
+
+func (reply *fakeLine) Format(client *Client, write chan<- string) {
+	write <- reply.line
+}
+
+func collectLines(t *testing.T, client *Client, reply Reply) []string {
+	t.Helper()
+	write := make(chan string, 16)
+	reply.Format(client, write)
+	close(write)
+	var lines []string
+	for line := range write {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func hasTag(line string, key string) bool {
+	if len(line) == 0 || line[0] != '@' {
+		return false
+	}
+	spaceIdx := -1
+	for i, r := range line {
+		if r == ' ' {
+			spaceIdx = i
+			break
+		}
+	}
+	if spaceIdx < 0 {
+		return false
+	}
+	tagPart := line[1:spaceIdx]
+	for _, pair := range splitTags(tagPart) {
+		if len(pair) >= len(key) && pair[:len(key)] == key {
+			return true
+		}
+	}
+	return false
+}
+
+func splitTags(tagPart string) []string {
+	var tags []string
+	start := 0
+	for i, r := range tagPart {
+		if r == ';' {
+			tags = append(tags, tagPart[start:i])
+			start = i + 1
+		}
+	}
+	tags = append(tags, tagPart[start:])
+	return tags
+}
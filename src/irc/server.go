@@ -0,0 +1,39 @@
+package irc
+
+import "time"
+
+// Server is the process-wide state shared by every connected client: the
+// channels that exist, and the feature tokens advertised in RPL_ISUPPORT.
+type Server struct {
+	name     string
+	ctime    time.Time
+	channels map[string]*Channel
+
+	isupport *ISupportTokens
+}
+
+func NewServer(name string) *Server {
+	return &Server{
+		name:     name,
+		ctime:    time.Now(),
+		channels: make(map[string]*Channel),
+		isupport: DefaultISupportTokens(),
+	}
+}
+
+func (server *Server) Id() string {
+	return server.name
+}
+
+func (server *Server) PublicId() string {
+	return server.name
+}
+
+func (server *Server) Nick() string {
+	return server.name
+}
+
+// Channel looks up a channel by name, or nil if it doesn't exist.
+func (server *Server) Channel(name string) *Channel {
+	return server.channels[name]
+}